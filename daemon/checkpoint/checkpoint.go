@@ -0,0 +1,179 @@
+// Package checkpoint implements container checkpoint/restore on top of
+// CRIU (Checkpoint/Restore In Userspace), talking to it over its RPC
+// protocol in SWRK mode: each Checkpoint or Restore call spawns a
+// `criu swrk` child and drives it over a socketpair, exactly as CRIU's own
+// libcriu client does.
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	criu "github.com/checkpoint-restore/go-criu/v7"
+	"github.com/checkpoint-restore/go-criu/v7/rpc"
+	"github.com/containerd/containerd/v2/pkg/tracing"
+	"github.com/docker/docker/image/tarexport"
+	"google.golang.org/protobuf/proto"
+)
+
+// NetworkQuiescer pauses and resumes a container's network sandbox (its
+// iptables/nftables rules and routes) around a CRIU dump or restore, so
+// the sandbox never observes the namespace mid-mutation. libnetwork's
+// sandbox satisfies this interface.
+type NetworkQuiescer interface {
+	Lock() error
+	Unlock() error
+}
+
+// Options configures a single Checkpoint or Restore call.
+type Options struct {
+	// ImagesDir is the directory CRIU reads/writes its checkpoint images
+	// from/to. It is normally a subdirectory of the container's state
+	// dir, so it survives a container being removed independently of the
+	// daemon's own state.
+	ImagesDir string
+	// LeaveRunning keeps the container running after a successful
+	// checkpoint instead of leaving it stopped. Ignored by Restore.
+	LeaveRunning bool
+	// TCPEstablished allows checkpointing or restoring a container with
+	// established TCP connections.
+	TCPEstablished bool
+	// ExternalUnixSockets allows checkpointing or restoring a container
+	// that holds open Unix domain sockets.
+	ExternalUnixSockets bool
+	// FileLocks allows checkpointing or restoring a container that holds
+	// POSIX file locks.
+	FileLocks bool
+	// External lists `key:value` entries, in the form CRIU's --external
+	// flag expects, for mountpoints that live outside the container's
+	// own mount namespace and must be resolved by name rather than
+	// re-created from scratch (e.g. bind-mounted volumes).
+	External []string
+	// Network, if set, is quiesced around the dump/restore.
+	Network NetworkQuiescer
+}
+
+// Checkpoint dumps the running container process identified by pid into
+// opts.ImagesDir. containerID and checkpointName identify the container
+// and checkpoint being created, purely for tracing and for the
+// CheckpointDescriptor embedded in archive; CRIU itself only ever sees
+// pid and opts.
+//
+// If archive is non-nil, the resulting CRIU images are also packaged,
+// together with containerID, into a self-contained, transferable
+// checkpoint tar via tarexport.CheckpointSave, so the checkpoint can
+// outlive opts.ImagesDir (for example across a `docker checkpoint export`
+// style command).
+func Checkpoint(ctx context.Context, containerID, checkpointName string, pid int, opts Options, archive io.Writer) (outErr error) {
+	ctx, span := tracing.StartSpan(ctx, "checkpoint.Checkpoint")
+	span.SetAttributes(tracing.Attribute("container.id", containerID), tracing.Attribute("checkpoint.name", checkpointName))
+	defer span.End()
+	defer func() { span.SetStatus(outErr) }()
+
+	if err := os.MkdirAll(opts.ImagesDir, 0o700); err != nil {
+		return fmt.Errorf("checkpoint: creating images dir: %w", err)
+	}
+	imagesDir, err := os.Open(opts.ImagesDir)
+	if err != nil {
+		return fmt.Errorf("checkpoint: opening images dir: %w", err)
+	}
+	defer imagesDir.Close()
+
+	c := criu.MakeCriu()
+	if err := c.Prepare(); err != nil {
+		return fmt.Errorf("checkpoint: starting criu swrk: %w", err)
+	}
+	defer c.Cleanup()
+
+	criuOpts := &rpc.CriuOpts{
+		Pid:            proto.Int32(int32(pid)),
+		ImagesDirFd:    proto.Int32(int32(imagesDir.Fd())),
+		LogLevel:       proto.Int32(4),
+		LogFile:        proto.String("dump.log"),
+		LeaveRunning:   proto.Bool(opts.LeaveRunning),
+		TcpEstablished: proto.Bool(opts.TCPEstablished),
+		ExtUnixSk:      proto.Bool(opts.ExternalUnixSockets),
+		FileLocks:      proto.Bool(opts.FileLocks),
+		External:       opts.External,
+		NotifyScripts:  proto.Bool(true),
+	}
+
+	if err := c.Dump(criuOpts, newNotify(opts.Network)); err != nil {
+		return fmt.Errorf("checkpoint: criu dump: %w", err)
+	}
+
+	if archive == nil {
+		return nil
+	}
+	return tarexport.CheckpointSave(ctx, opts.ImagesDir, tarexport.CheckpointDescriptor{
+		ContainerID: containerID,
+	}, archive)
+}
+
+// Restore restores a container previously checkpointed by Checkpoint and
+// returns the pid CRIU assigned to its restored init process.
+// containerID and checkpointName identify the container and checkpoint
+// being restored, purely for tracing.
+//
+// If archive is non-nil, it is extracted via tarexport.CheckpointLoad
+// into a temporary directory first, and opts.ImagesDir is ignored in
+// favor of the images that archive contained; otherwise opts.ImagesDir is
+// read directly, as left behind by a prior Checkpoint call.
+func Restore(ctx context.Context, containerID, checkpointName string, opts Options, archive io.Reader) (_ int, outErr error) {
+	ctx, span := tracing.StartSpan(ctx, "checkpoint.Restore")
+	span.SetAttributes(tracing.Attribute("container.id", containerID), tracing.Attribute("checkpoint.name", checkpointName))
+	defer span.End()
+	defer func() { span.SetStatus(outErr) }()
+
+	imagesDirPath := opts.ImagesDir
+	if archive != nil {
+		tmpDir, err := os.MkdirTemp("", "checkpoint-restore-")
+		if err != nil {
+			return 0, fmt.Errorf("restore: extracting checkpoint archive: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		desc, err := tarexport.CheckpointLoad(ctx, archive, tmpDir)
+		if err != nil {
+			return 0, fmt.Errorf("restore: extracting checkpoint archive: %w", err)
+		}
+		if desc.ContainerID != "" && desc.ContainerID != containerID {
+			return 0, fmt.Errorf("restore: checkpoint archive was taken from container %s, not %s", desc.ContainerID, containerID)
+		}
+		imagesDirPath = filepath.Join(tmpDir, "images")
+	}
+
+	imagesDir, err := os.Open(imagesDirPath)
+	if err != nil {
+		return 0, fmt.Errorf("restore: opening images dir: %w", err)
+	}
+	defer imagesDir.Close()
+
+	c := criu.MakeCriu()
+	if err := c.Prepare(); err != nil {
+		return 0, fmt.Errorf("restore: starting criu swrk: %w", err)
+	}
+	defer c.Cleanup()
+
+	criuOpts := &rpc.CriuOpts{
+		ImagesDirFd:    proto.Int32(int32(imagesDir.Fd())),
+		LogLevel:       proto.Int32(4),
+		LogFile:        proto.String("restore.log"),
+		TcpEstablished: proto.Bool(opts.TCPEstablished),
+		ExtUnixSk:      proto.Bool(opts.ExternalUnixSockets),
+		FileLocks:      proto.Bool(opts.FileLocks),
+		External:       opts.External,
+		NotifyScripts:  proto.Bool(true),
+	}
+
+	nfy := newNotify(opts.Network)
+	if err := c.Restore(criuOpts, nfy); err != nil {
+		return 0, fmt.Errorf("restore: criu restore: %w", err)
+	}
+	if nfy.restoredPid == 0 {
+		return 0, fmt.Errorf("restore: criu did not report a restored pid")
+	}
+	return int(nfy.restoredPid), nil
+}
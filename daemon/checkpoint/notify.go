@@ -0,0 +1,46 @@
+package checkpoint
+
+import (
+	criu "github.com/checkpoint-restore/go-criu/v7"
+)
+
+// notify implements criu.Notify to drive libnetwork's network-lock /
+// network-unlock around a dump or restore, and to record the pid CRIU
+// assigns to a restored process.
+type notify struct {
+	criu.NoNotify
+	network     NetworkQuiescer
+	restoredPid int32
+}
+
+func newNotify(network NetworkQuiescer) *notify {
+	return &notify{network: network}
+}
+
+// NetworkLock is invoked by CRIU right before it starts quiescing the
+// container for a dump; it pauses libnetwork's management of the
+// sandbox's iptables/nftables rules so CRIU doesn't race with rule
+// changes mid-dump.
+func (n *notify) NetworkLock() error {
+	if n.network == nil {
+		return nil
+	}
+	return n.network.Lock()
+}
+
+// NetworkUnlock resumes libnetwork's management of the sandbox once CRIU
+// is done manipulating the network namespace, on both dump and restore.
+func (n *notify) NetworkUnlock() error {
+	if n.network == nil {
+		return nil
+	}
+	return n.network.Unlock()
+}
+
+// PostRestore is invoked once CRIU has fully restored the container's
+// process tree; pid is the restored init process's pid in the root pid
+// namespace.
+func (n *notify) PostRestore(pid int32) error {
+	n.restoredPid = pid
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package blobcache implements a content-addressable, disk-backed cache
+// from a compressed blob's digest, as observed on the wire during a pull
+// or in a tar during a load, to a decompressed copy of its content. It
+// lets callers such as image/tarexport skip decompression entirely for a
+// blob they have already processed, the same way buildah/containers-image's
+// blobcache avoids re-pulling blobs it already has on disk.
+package blobcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrNotFound is returned by Open when no decompressed copy is cached for
+// the requested digest.
+var ErrNotFound = errors.New("blobcache: not cached")
+
+// Stats reports cumulative cache activity.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Bytes  int64
+}
+
+// Cache is a bounded, LRU, disk-backed cache from a compressed blob's
+// digest to a decompressed copy of its content. Cache is safe for
+// concurrent use.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu        sync.Mutex
+	usedBytes int64
+	entries   map[digest.Digest]*list.Element // -> *cacheItem
+	lru       *list.List
+	stats     Stats
+}
+
+type cacheItem struct {
+	digest digest.Digest
+	bytes  int64
+}
+
+// New returns a Cache that stores decompressed blob copies under dir and
+// evicts least-recently-used entries, oldest first, once their total size
+// would exceed maxBytes. A maxBytes of 0 disables the byte budget.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if dir == "" {
+		return nil, errors.New("blobcache: dir must not be empty")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("blobcache: creating cache dir: %w", err)
+	}
+	return &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[digest.Digest]*list.Element),
+		lru:      list.New(),
+	}, nil
+}
+
+// Open returns a reader for the decompressed copy of the compressed blob
+// identified by dgst, marking it as most-recently-used. It returns
+// ErrNotFound if no copy is cached. Callers must Close the returned
+// reader.
+func (c *Cache) Open(dgst digest.Digest) (io.ReadCloser, error) {
+	c.mu.Lock()
+	el, ok := c.entries[dgst]
+	if ok {
+		c.lru.MoveToFront(el)
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return os.Open(c.blobPath(dgst))
+}
+
+// SpillWriter incrementally writes a decompressed copy of a blob to a
+// temporary file in the cache directory. Commit makes it visible to
+// Open; Abort discards it.
+type SpillWriter struct {
+	cache *Cache
+	dgst  digest.Digest
+	tmp   *os.File
+	size  int64
+	done  bool
+}
+
+// BeginSpill starts caching a decompressed copy of the blob identified by
+// dgst. The caller writes the decompressed content to the returned
+// SpillWriter and calls Commit once it has been written in full, or
+// Abort otherwise.
+func (c *Cache) BeginSpill(dgst digest.Digest) (*SpillWriter, error) {
+	tmp, err := os.CreateTemp(c.dir, "blob-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("blobcache: creating spill file: %w", err)
+	}
+	return &SpillWriter{cache: c, dgst: dgst, tmp: tmp}, nil
+}
+
+func (w *SpillWriter) Write(p []byte) (int, error) {
+	n, err := w.tmp.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Abort discards the spill file. It is a no-op once Commit has succeeded.
+func (w *SpillWriter) Abort() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
+
+// Commit finalizes the spill file, making it visible to Open, and evicts
+// older entries, least-recently-used first, until the cache is back
+// within its byte budget.
+func (w *SpillWriter) Commit() error {
+	if w.done {
+		return errors.New("blobcache: spill already committed or aborted")
+	}
+	w.done = true
+	if err := w.tmp.Sync(); err != nil {
+		w.tmp.Close()
+		os.Remove(w.tmp.Name())
+		return err
+	}
+	name := w.tmp.Name()
+	w.tmp.Close()
+	if err := os.Rename(name, w.cache.blobPath(w.dgst)); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("blobcache: finalizing spill file: %w", err)
+	}
+	w.cache.record(w.dgst, w.size)
+	return nil
+}
+
+func (c *Cache) blobPath(dgst digest.Digest) string {
+	return filepath.Join(c.dir, dgst.Algorithm().String()+"-"+dgst.Encoded())
+}
+
+func (c *Cache) record(dgst digest.Digest, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[dgst]; ok {
+		c.lru.MoveToFront(el)
+		item := el.Value.(*cacheItem)
+		c.usedBytes += bytes - item.bytes
+		item.bytes = bytes
+		c.stats.Bytes = c.usedBytes
+		c.evictLocked()
+		return
+	}
+
+	el := c.lru.PushFront(&cacheItem{digest: dgst, bytes: bytes})
+	c.entries[dgst] = el
+	c.usedBytes += bytes
+	c.stats.Bytes = c.usedBytes
+
+	c.evictLocked()
+}
+
+// evictLocked removes least-recently-used entries, and their on-disk
+// copies, until the cache is within its byte budget. c.mu must be held.
+func (c *Cache) evictLocked() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.usedBytes > c.maxBytes {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		item := el.Value.(*cacheItem)
+		c.lru.Remove(el)
+		delete(c.entries, item.digest)
+		os.Remove(c.blobPath(item.digest))
+		c.usedBytes -= item.bytes
+		c.stats.Bytes = c.usedBytes
+	}
+}
+
+// Stats returns a snapshot of cumulative cache activity.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,143 @@
+// Package signature implements a small signature verification policy
+// modeled on containers/image's signature policy: an ordered list of
+// {pattern, keys, identities} rules matched against an image reference,
+// used to verify cosign-style signatures before a loaded or pulled image
+// is trusted. It does not yet verify in-toto/SLSA attestations.
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/distribution/reference"
+)
+
+// PublicKey is a signer's public key, restricted to the algorithms cosign
+// commonly uses for keyed (non-Fulcio) signing.
+type PublicKey struct {
+	// KeyID identifies the key within signature metadata; cosign and
+	// in-toto signatures carry a matching key ID so a verifier knows
+	// which key to try before doing the signature check itself.
+	KeyID string
+	Key   crypto.PublicKey
+}
+
+// Rule matches one or more image references against the keys and
+// identities allowed to sign them.
+type Rule struct {
+	// Pattern is a reference pattern the rule applies to, e.g.
+	// "docker.io/library/*" or "*" to match every reference.
+	Pattern string
+	// Keys are the public keys a valid signature must verify against.
+	Keys []PublicKey
+	// Identities restricts which signer identities (e.g. a Fulcio
+	// certificate SAN, for keyless signing) are accepted; empty means any
+	// identity that verifies against Keys is accepted.
+	//
+	// NOTE: Fulcio certificate chain verification itself is not yet
+	// implemented; Identities is only checked against a Signature's KeyID
+	// today, which covers long-lived keyed signing but not keyless/Fulcio
+	// signatures.
+	Identities []string
+}
+
+// Policy is an ordered list of Rules, evaluated as containers/image does:
+// the first Rule whose Pattern matches the reference applies, and a
+// reference matching no rule is rejected.
+type Policy struct {
+	Rules []Rule
+}
+
+// ErrNoMatchingRule is returned by RuleFor when no rule's Pattern matches
+// the reference being evaluated.
+var ErrNoMatchingRule = errors.New("signature: no policy rule matches reference")
+
+// RuleFor returns the first Rule in p whose Pattern matches ref. An empty
+// ref, as for an OCI manifest with no org.opencontainers.image.ref.name
+// annotation, can't be parsed as a reference at all and so can never match
+// a named Pattern like "docker.io/library/*" — but it can still match the
+// catch-all Pattern "*", the same way an unnamed image falls under a
+// default scope in containers/image's policy.json.
+func (p *Policy) RuleFor(ref string) (Rule, error) {
+	if ref == "" {
+		for _, r := range p.Rules {
+			if r.Pattern == "*" {
+				return r, nil
+			}
+		}
+		return Rule{}, ErrNoMatchingRule
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return Rule{}, fmt.Errorf("signature: parsing reference %q: %w", ref, err)
+	}
+	for _, r := range p.Rules {
+		if r.Pattern == "*" {
+			return r, nil
+		}
+		ok, err := reference.FamiliarMatch(r.Pattern, named)
+		if err != nil {
+			return Rule{}, err
+		}
+		if !ok {
+			ok, _ = path.Match(r.Pattern, named.Name())
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return Rule{}, ErrNoMatchingRule
+}
+
+// Signature is a single detached signature over a manifest digest, in
+// cosign's "simple signing" form: Payload is the canonical JSON payload
+// naming the signed manifest digest, and Sig is the signature over
+// Payload (for ECDSA keys, over sha256(Payload)).
+type Signature struct {
+	KeyID   string
+	Payload []byte
+	Sig     []byte
+}
+
+// Verify reports whether sig verifies against a key this rule permits,
+// and whether its identity (if the rule restricts identities) is allowed.
+func (r Rule) Verify(sig Signature) error {
+	if len(r.Identities) > 0 && !containsString(r.Identities, sig.KeyID) {
+		return fmt.Errorf("signature: identity %q is not permitted by policy", sig.KeyID)
+	}
+	for _, k := range r.Keys {
+		if k.KeyID != "" && k.KeyID != sig.KeyID {
+			continue
+		}
+		if verifyWithKey(k.Key, sig.Payload, sig.Sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature: no configured key verified signature %q", sig.KeyID)
+}
+
+func verifyWithKey(key crypto.PublicKey, payload, sig []byte) bool {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	default:
+		return false
+	}
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package tarexport
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/docker/docker/distribution/blobcache"
+	"github.com/opencontainers/go-digest"
+)
+
+// blobCacheMu guards globalBlobCache the same way loadPolicyMu guards
+// globalLoadPolicy: SetBlobCache can race with the pool of goroutines
+// Load spawns to decompress layers concurrently.
+var blobCacheMu sync.RWMutex
+
+// globalBlobCache, when non-nil, lets prepareLayer skip decompressing a
+// layer blob it has already decompressed during a previous load, keyed by
+// the digest of the blob's compressed bytes. Only prepareLayer fills it;
+// pull and save neither read nor fill it. It is installed by SetBlobCache;
+// a nil cache (the default) disables the fast path entirely. Access it
+// only through currentBlobCache.
+var globalBlobCache *blobcache.Cache
+
+// SetBlobCache installs the content-addressable cache that prepareLayer
+// consults before decompressing a layer blob; passing nil disables the
+// cache. Nothing in the daemon calls it, so the cache stays disabled
+// unless a caller installs one.
+func SetBlobCache(c *blobcache.Cache) {
+	blobCacheMu.Lock()
+	defer blobCacheMu.Unlock()
+	globalBlobCache = c
+}
+
+// currentBlobCache returns the cache installed by the most recent
+// SetBlobCache call, or nil if none was installed.
+func currentBlobCache() *blobcache.Cache {
+	blobCacheMu.RLock()
+	defer blobCacheMu.RUnlock()
+	return globalBlobCache
+}
+
+// digestFile returns the canonical digest of filename's raw (still
+// compressed, if applicable) content.
+func digestFile(filename string) (digest.Digest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(digester.Hash(), f); err != nil {
+		return "", err
+	}
+	return digester.Digest(), nil
+}
@@ -0,0 +1,113 @@
+package tarexport
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/go-archive/chrootarchive"
+)
+
+// checkpointManifestFileName names the JSON descriptor CheckpointSave
+// writes alongside the CRIU images directory inside a checkpoint tar.
+//
+// Checkpoints are their own self-contained tar artifact, used by
+// daemon/checkpoint's Checkpoint and Restore to make a CRIU dump
+// transferable, rather than a new field on manifestItem: a checkpoint
+// isn't tied to a single image the way manifestItem's layers are.
+const checkpointManifestFileName = "checkpoint.json"
+
+// CheckpointDescriptor is the JSON document CheckpointSave embeds in a
+// checkpoint tar next to the CRIU images.
+//
+// It originally also carried an Image reference, a PreDumpChainID, and a
+// Spec snapshot, so Restore could check it was restoring onto a
+// compatible image and detect spec drift before handing control to CRIU.
+// Nothing in this tree plumbs a container's image reference, chain ID, or
+// runtime spec into daemon/checkpoint.Checkpoint to populate them, and no
+// caller of Checkpoint exists yet either, so carrying those fields around
+// unset would just be dead weight; they were dropped rather than shipped
+// unwired, the same way RequireAttestationPredicates was dropped from
+// Rule. Re-add them once Checkpoint actually receives that information
+// from its caller.
+type CheckpointDescriptor struct {
+	// ContainerID is the ID of the container the checkpoint was taken from.
+	ContainerID string
+}
+
+// CheckpointSave writes the CRIU checkpoint images found under imagesDir,
+// plus desc, into outTar as a standalone checkpoint archive.
+func CheckpointSave(ctx context.Context, imagesDir string, desc CheckpointDescriptor, outTar io.Writer) error {
+	tw := tar.NewWriter(outTar)
+	defer tw.Close()
+
+	descJSON, err := json.Marshal(desc)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name: checkpointManifestFileName,
+		Mode: 0o644,
+		Size: int64(len(descJSON)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(descJSON); err != nil {
+		return err
+	}
+
+	return filepath.Walk(imagesDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(imagesDir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := tw.WriteHeader(&tar.Header{
+			Name: filepath.Join("images", rel),
+			Mode: 0o644,
+			Size: fi.Size(),
+		}); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// CheckpointLoad extracts a checkpoint archive written by CheckpointSave
+// into destDir and returns its descriptor. The caller should then point
+// checkpoint.Options.ImagesDir at filepath.Join(destDir, "images") before
+// calling checkpoint.Restore.
+func CheckpointLoad(ctx context.Context, inTar io.Reader, destDir string) (CheckpointDescriptor, error) {
+	var desc CheckpointDescriptor
+	if err := chrootarchive.Untar(inTar, destDir, nil); err != nil {
+		return desc, err
+	}
+	descJSON, err := os.ReadFile(filepath.Join(destDir, checkpointManifestFileName))
+	if err != nil {
+		return desc, fmt.Errorf("checkpoint: reading descriptor: %w", err)
+	}
+	if err := json.Unmarshal(descJSON, &desc); err != nil {
+		return desc, err
+	}
+	return desc, nil
+}
@@ -10,12 +10,14 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sync"
 
 	"github.com/containerd/containerd/v2/pkg/tracing"
 	"github.com/containerd/log"
 	"github.com/distribution/reference"
 	"github.com/docker/distribution"
 	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/distribution/blobcache"
 	"github.com/docker/docker/image"
 	v1 "github.com/docker/docker/image/v1"
 	"github.com/docker/docker/internal/ioutils"
@@ -53,6 +55,24 @@ func (l *tarexporter) Load(ctx context.Context, inTar io.ReadCloser, outStream i
 		return err
 	}
 
+	// pool bounds concurrent manifest/index entries; layerPool separately
+	// bounds concurrent layer decompression across all of them. These must
+	// stay two distinct semaphores: an entry's goroutine holds a pool slot
+	// for its entire duration, including while it blocks dispatching its
+	// own layer jobs, so if layer jobs drew from the same semaphore as
+	// their enclosing entry, every entry could end up holding the pool's
+	// only slots while waiting for a slot only an entry's own layer jobs
+	// could free — a guaranteed deadlock once concurrent entries reach the
+	// pool size (trivially true at the default width of 1 on a
+	// GOMAXPROCS=1 host).
+	pool := newLoaderPool(0)
+	layerPool := newLoaderPool(0)
+	pooledProgress := syncProgress(progressOutput)
+
+	if isOCILayout(tmpDir) {
+		return l.ociLoad(ctx, pool, layerPool, tmpDir, outStream, pooledProgress)
+	}
+
 	// read manifest, if no file then load in legacy mode
 	manifestPath, err := safePath(tmpDir, manifestFileName)
 	if err != nil {
@@ -61,7 +81,7 @@ func (l *tarexporter) Load(ctx context.Context, inTar io.ReadCloser, outStream i
 	manifestFile, err := os.Open(manifestPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return l.legacyLoad(tmpDir, outStream, progressOutput)
+			return l.legacyLoad(ctx, pool, tmpDir, outStream, pooledProgress)
 		}
 		return err
 	}
@@ -76,75 +96,60 @@ func (l *tarexporter) Load(ctx context.Context, inTar io.ReadCloser, outStream i
 		return err
 	}
 
-	var parentLinks []parentLink
-	var imageIDsStr string
-	var imageRefCount int
+	results := make([]*manifestLoadResult, len(manifest))
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
 
-	for _, m := range manifest {
+	for i, m := range manifest {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-		configPath, err := safePath(tmpDir, m.Config)
-		if err != nil {
-			return err
-		}
-		config, err := os.ReadFile(configPath)
-		if err != nil {
-			return err
-		}
-		img, err := image.NewFromJSON(config)
-		if err != nil {
+
+		i, m := i, m
+		wg.Add(1)
+		if err := pool.Go(ctx, func() {
+			defer wg.Done()
+			res, err := l.loadManifestItem(ctx, layerPool, tmpDir, m, pooledProgress)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			results[i] = res
+		}); err != nil {
+			wg.Done()
+			wg.Wait()
 			return err
 		}
-		if err := image.CheckOS(img.OperatingSystem()); err != nil {
-			return fmt.Errorf("cannot load %s image on %s", img.OperatingSystem(), runtime.GOOS)
-		}
-		if l.platformMatcher != nil && !l.platformMatcher.Match(img.Platform()) {
-			continue
-		}
-		rootFS := *img.RootFS
-		rootFS.DiffIDs = nil
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
 
-		if expected, actual := len(m.Layers), len(img.RootFS.DiffIDs); expected != actual {
-			return fmt.Errorf("invalid manifest, layers length mismatch: expected %d, got %d", expected, actual)
-		}
+	var parentLinks []parentLink
+	var imageIDsStr string
+	var imageRefCount int
 
-		for i, diffID := range img.RootFS.DiffIDs {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-			layerPath, err := safePath(tmpDir, m.Layers[i])
-			if err != nil {
-				return err
-			}
-			r := rootFS
-			r.Append(diffID)
-			newLayer, err := l.lss.Get(r.ChainID())
-			if err != nil {
-				newLayer, err = l.loadLayer(ctx, layerPath, rootFS, diffID.String(), m.LayerSources[diffID], progressOutput)
-				if err != nil {
-					return err
-				}
-			}
+	for _, res := range results {
+		if res == nil {
+			// Skipped because it didn't match l.platformMatcher.
+			continue
+		}
+		for _, newLayer := range res.layers {
 			defer layer.ReleaseAndLog(l.lss, newLayer)
-			if expected, actual := diffID, newLayer.DiffID(); expected != actual {
-				return fmt.Errorf("invalid diffID for layer %d: expected %q, got %q", i, expected, actual)
-			}
-			rootFS.Append(diffID)
 		}
 
-		imgID, err := l.is.Create(config)
+		imgID, err := l.is.Create(res.config)
 		if err != nil {
 			return err
 		}
 		imageIDsStr += fmt.Sprintf("Loaded image ID: %s\n", imgID)
 
 		imageRefCount = 0
-		for _, repoTag := range m.RepoTags {
+		for _, repoTag := range res.m.RepoTags {
 			named, err := reference.ParseNormalizedNamed(repoTag)
 			if err != nil {
 				return err
@@ -158,7 +163,7 @@ func (l *tarexporter) Load(ctx context.Context, inTar io.ReadCloser, outStream i
 			imageRefCount++
 		}
 
-		parentLinks = append(parentLinks, parentLink{imgID, m.Parent})
+		parentLinks = append(parentLinks, parentLink{imgID, res.m.Parent})
 		l.loggerImgEvent.LogImageEvent(ctx, imgID.String(), imgID.String(), events.ActionLoad)
 	}
 
@@ -177,6 +182,86 @@ func (l *tarexporter) Load(ctx context.Context, inTar io.ReadCloser, outStream i
 	return nil
 }
 
+// manifestLoadResult holds the outcome of loadManifestItem: the raw config
+// blob to pass to l.is.Create, the layers it registered (kept around so
+// Load can hold them until it returns, after every item's image has been
+// created), and
+// the manifestItem itself for tagging and parent-linking.
+type manifestLoadResult struct {
+	config []byte
+	layers []layer.Layer
+	m      manifestItem
+}
+
+// loadManifestItem registers the layers and decodes the config described by
+// a single manifest.json entry. It is safe to call concurrently for
+// different entries: entries other than m are never touched, and layers
+// belonging to the same image are still registered in chain order since
+// each one depends on the ChainID produced by the previous, though their
+// decompression (see loadLayers) is not. It returns a nil result, with no
+// error, for an entry that doesn't match l.platformMatcher.
+//
+// layerPool must be a different pool than whatever one the caller used to
+// reach loadManifestItem itself (see Load): loadLayers dispatches its own
+// layer jobs onto layerPool while this call's own pool slot, if any, is
+// still held, so sharing a single pool across both levels would deadlock
+// as soon as concurrent entries reached the pool's width.
+//
+// It does not enforce globalLoadPolicy: the legacy Docker manifest.json
+// format has no OCI 1.1 "subject" field, so there is nothing for
+// verifyOCISignatures to locate a signature through for it.
+func (l *tarexporter) loadManifestItem(ctx context.Context, layerPool *loaderPool, tmpDir string, m manifestItem, progressOutput progress.Output) (*manifestLoadResult, error) {
+	configPath, err := safePath(tmpDir, m.Config)
+	if err != nil {
+		return nil, err
+	}
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	img, err := image.NewFromJSON(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := image.CheckOS(img.OperatingSystem()); err != nil {
+		return nil, fmt.Errorf("cannot load %s image on %s", img.OperatingSystem(), runtime.GOOS)
+	}
+	if l.platformMatcher != nil && !l.platformMatcher.Match(img.Platform()) {
+		return nil, nil
+	}
+	rootFS := *img.RootFS
+	rootFS.DiffIDs = nil
+
+	if expected, actual := len(m.Layers), len(img.RootFS.DiffIDs); expected != actual {
+		return nil, fmt.Errorf("invalid manifest, layers length mismatch: expected %d, got %d", expected, actual)
+	}
+
+	jobs := make([]layerJob, len(img.RootFS.DiffIDs))
+	for i, diffID := range img.RootFS.DiffIDs {
+		layerPath, err := safePath(tmpDir, m.Layers[i])
+		if err != nil {
+			return nil, err
+		}
+		jobs[i] = layerJob{diffID: diffID, path: layerPath, foreignSrc: m.LayerSources[diffID]}
+	}
+
+	newLayers, err := l.loadLayers(ctx, layerPool, rootFS, jobs, progressOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	return &manifestLoadResult{config: config, layers: newLayers, m: m}, nil
+}
+
+// untar fully extracts inTar to tmpDir before Load reads anything back out
+// of it, rather than streaming tar entries directly into loadLayers'
+// worker pool. safePath and ociBlobPath resolve every path Load,
+// legacyLoad, and ociLoad use against tmpDir as a real directory on disk,
+// throughout the whole package; switching to a streaming pipeline would
+// mean reworking that shared assumption everywhere it's used, not just
+// here, so it's intentionally out of scope for this pass. The concurrency
+// improvements in loadLayers still cut wall-clock time for the
+// decompression step itself, just not the up-front extraction.
 func untar(ctx context.Context, inTar io.ReadCloser, tmpDir string) error {
 	_, trace := tracing.StartSpan(ctx, "chrootarchive.Untar")
 	defer trace.End()
@@ -201,20 +286,145 @@ func (l *tarexporter) setParentID(id, parentID image.ID) error {
 	return l.is.SetParent(id, parentID)
 }
 
-func (l *tarexporter) loadLayer(ctx context.Context, filename string, rootFS image.RootFS, id string, foreignSrc distribution.Descriptor, progressOutput progress.Output) (_ layer.Layer, outErr error) {
-	ctx, span := tracing.StartSpan(ctx, "loadLayer")
-	span.SetAttributes(tracing.Attribute("image.id", id))
+// layerJob is one layer.DiffID to register onto an image's rootFS,
+// resolved to its on-disk tar path.
+type layerJob struct {
+	diffID     layer.DiffID
+	path       string
+	foreignSrc distribution.Descriptor
+}
+
+// preparedLayer is the outcome of preparing a layerJob's content for
+// registration, before it is known whether the layer store already has
+// it: either it was already registered (cached) under the chain the job
+// expects, or its content is ready to register from one of spillPath (a
+// freshly decompressed temporary file owned by the caller) or
+// cachedBlob (a digest to re-open from globalBlobCache at registration
+// time).
+type preparedLayer struct {
+	cached     layer.Layer
+	spillPath  string
+	cachedBlob digest.Digest
+}
+
+// loadLayers registers each job in jobs onto rootFS, in the given order,
+// and returns the resulting layer.Layer for each, verifying its DiffID
+// matches the manifest's claim. Layers already present in the layer
+// store are looked up directly; the rest are decompressed concurrently,
+// bounded by layerPool, since decompression doesn't depend on chain order
+// the way registration does: each Register call still needs its parent
+// chain already committed to the store, so that part stays sequential.
+//
+// layerPool must be the single pool shared across every concurrent
+// loadLayers call for the whole Load (see Load), not the pool used to
+// reach loadLayers' own caller: dispatching layer jobs onto the same pool
+// an entry-level goroutine is already occupying a slot in would deadlock
+// once concurrent entries reached the pool's width.
+func (l *tarexporter) loadLayers(ctx context.Context, layerPool *loaderPool, rootFS image.RootFS, jobs []layerJob, progressOutput progress.Output) ([]layer.Layer, error) {
+	chainIDs := make([]layer.ChainID, len(jobs))
+	r := rootFS
+	for i, j := range jobs {
+		r.Append(j.diffID)
+		chainIDs[i] = r.ChainID()
+	}
+
+	prepared := make([]preparedLayer, len(jobs))
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for i, j := range jobs {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if cached, err := l.lss.Get(chainIDs[i]); err == nil {
+			prepared[i] = preparedLayer{cached: cached}
+			continue
+		}
+
+		i, j := i, j
+		wg.Add(1)
+		if err := layerPool.Go(ctx, func() {
+			defer wg.Done()
+			p, err := l.prepareLayer(ctx, j.path, progressOutput, j.diffID.String())
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			prepared[i] = p
+		}); err != nil {
+			wg.Done()
+			wg.Wait()
+			return nil, err
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		for _, p := range prepared {
+			if p.spillPath != "" {
+				os.Remove(p.spillPath)
+			}
+		}
+		return nil, firstErr
+	}
+
+	newLayers := make([]layer.Layer, 0, len(jobs))
+	for i, j := range jobs {
+		p := prepared[i]
+		newLayer := p.cached
+		if newLayer == nil {
+			var err error
+			newLayer, err = l.registerPreparedLayer(p, rootFS, j.foreignSrc)
+			if p.spillPath != "" {
+				os.Remove(p.spillPath)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if expected, actual := j.diffID, newLayer.DiffID(); expected != actual {
+			return nil, fmt.Errorf("invalid diffID for layer %d: expected %q, got %q", i, expected, actual)
+		}
+		newLayers = append(newLayers, newLayer)
+		rootFS.Append(j.diffID)
+	}
+	return newLayers, nil
+}
+
+// prepareLayer decompresses filename into a temporary file so it is ready
+// to register once its turn in chain order comes up. It consults the
+// blob cache first: a blob this daemon has already decompressed, even for
+// a different image or parent chain, never needs decompressing twice. On
+// a miss, it populates the cache with the freshly decompressed content
+// for next time.
+func (l *tarexporter) prepareLayer(ctx context.Context, filename string, progressOutput progress.Output, label string) (_ preparedLayer, outErr error) {
+	ctx, span := tracing.StartSpan(ctx, "prepareLayer")
+	span.SetAttributes(tracing.Attribute("layer.diff_id", label))
 	defer span.End()
 	defer func() {
 		span.SetStatus(outErr)
 	}()
 
+	bc := currentBlobCache()
+	var compressedDigest digest.Digest
+	if bc != nil {
+		if dgst, err := digestFile(filename); err == nil {
+			compressedDigest = dgst
+			if rc, err := bc.Open(dgst); err == nil {
+				rc.Close()
+				return preparedLayer{cachedBlob: dgst}, nil
+			}
+		}
+	}
+
 	// We use sequential file access to avoid depleting the standby list on Windows.
 	// On Linux, this equates to a regular os.Open.
 	rawTar, err := sequential.Open(filename)
 	if err != nil {
 		log.G(context.TODO()).Debugf("Error reading embedded tar: %v", err)
-		return nil, err
+		return preparedLayer{}, err
 	}
 	defer rawTar.Close()
 
@@ -223,24 +433,77 @@ func (l *tarexporter) loadLayer(ctx context.Context, filename string, rootFS ima
 		fileInfo, err := rawTar.Stat()
 		if err != nil {
 			log.G(context.TODO()).Debugf("Error statting file: %v", err)
-			return nil, err
+			return preparedLayer{}, err
 		}
 
-		r = progress.NewProgressReader(rawTar, progressOutput, fileInfo.Size(), stringid.TruncateID(id), "Loading layer")
+		r = progress.NewProgressReader(rawTar, progressOutput, fileInfo.Size(), stringid.TruncateID(label), "Loading layer")
 	} else {
 		r = rawTar
 	}
 
 	inflatedLayerData, err := compression.DecompressStream(ioutils.NewCtxReader(ctx, r))
 	if err != nil {
-		return nil, err
+		return preparedLayer{}, err
 	}
 	defer inflatedLayerData.Close()
 
+	spillFile, err := os.CreateTemp("", "docker-layer-")
+	if err != nil {
+		return preparedLayer{}, err
+	}
+	defer spillFile.Close()
+
+	var dest io.Writer = spillFile
+	var spill *blobcache.SpillWriter
+	if bc != nil && compressedDigest != "" {
+		if sw, err := bc.BeginSpill(compressedDigest); err == nil {
+			spill = sw
+			dest = io.MultiWriter(spillFile, spill)
+		}
+	}
+
+	if _, err := io.Copy(dest, inflatedLayerData); err != nil {
+		if spill != nil {
+			spill.Abort()
+		}
+		os.Remove(spillFile.Name())
+		return preparedLayer{}, err
+	}
+	if spill != nil {
+		if err := spill.Commit(); err != nil {
+			log.G(context.TODO()).WithError(err).Debug("tarexport: caching decompressed layer failed")
+		}
+	}
+
+	return preparedLayer{spillPath: spillFile.Name()}, nil
+}
+
+// registerPreparedLayer registers a non-cached preparedLayer's content
+// with the layer store.
+func (l *tarexporter) registerPreparedLayer(p preparedLayer, rootFS image.RootFS, foreignSrc distribution.Descriptor) (layer.Layer, error) {
+	var r io.ReadCloser
+	switch {
+	case p.spillPath != "":
+		f, err := os.Open(p.spillPath)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	case p.cachedBlob != "":
+		rc, err := currentBlobCache().Open(p.cachedBlob)
+		if err != nil {
+			return nil, err
+		}
+		r = rc
+	default:
+		return nil, errors.New("tarexport: no content to register")
+	}
+	defer r.Close()
+
 	if ds, ok := l.lss.(layer.DescribableStore); ok {
-		return ds.RegisterWithDescriptor(inflatedLayerData, rootFS.ChainID(), foreignSrc)
+		return ds.RegisterWithDescriptor(r, rootFS.ChainID(), foreignSrc)
 	}
-	return l.lss.Register(inflatedLayerData, rootFS.ChainID())
+	return l.lss.Register(r, rootFS.ChainID())
 }
 
 func (l *tarexporter) setLoadedTag(ref reference.Named, imgID digest.Digest, outStream io.Writer) error {
@@ -251,26 +514,52 @@ func (l *tarexporter) setLoadedTag(ref reference.Named, imgID digest.Digest, out
 	return l.rs.AddTag(ref, imgID, true)
 }
 
-func (l *tarexporter) legacyLoad(tmpDir string, outStream io.Writer, progressOutput progress.Output) error {
+func (l *tarexporter) legacyLoad(ctx context.Context, pool *loaderPool, tmpDir string, outStream io.Writer, progressOutput progress.Output) error {
 	if runtime.GOOS == "windows" {
 		return errors.New("Windows does not support legacy loading of images")
 	}
 
-	legacyLoadedMap := make(map[string]image.ID)
-
 	dirs, err := os.ReadDir(tmpDir)
 	if err != nil {
 		return err
 	}
 
-	// every dir represents an image
+	// Every dir represents an image. They may share ancestors through
+	// img.Parent, so loads are funneled through state, which makes sure a
+	// given oldID's image is only ever built once even if two dirs race to
+	// load the same parent; loading independent images concurrently is
+	// what actually benefits from the shared pool.
+	state := newLegacyLoadState()
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
 	for _, d := range dirs {
-		if d.IsDir() {
-			if err := l.legacyLoadImage(d.Name(), tmpDir, legacyLoadedMap, progressOutput); err != nil {
-				return err
+		if !d.IsDir() {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		oldID := d.Name()
+		wg.Add(1)
+		if err := pool.Go(ctx, func() {
+			defer wg.Done()
+			if _, err := l.legacyLoadImage(ctx, pool, oldID, tmpDir, state, progressOutput); err != nil {
+				errOnce.Do(func() { firstErr = err })
 			}
+		}); err != nil {
+			wg.Done()
+			wg.Wait()
+			return err
 		}
 	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
 
 	// load tags from repositories file
 	repositoriesPath, err := safePath(tmpDir, legacyRepositoriesFileName)
@@ -290,7 +579,7 @@ func (l *tarexporter) legacyLoad(tmpDir string, outStream io.Writer, progressOut
 
 	for name, tagMap := range repositories {
 		for tag, oldID := range tagMap {
-			imgID, ok := legacyLoadedMap[oldID]
+			imgID, ok := state.get(oldID)
 			if !ok {
 				return fmt.Errorf("invalid target ID: %v", oldID)
 			}
@@ -309,102 +598,151 @@ func (l *tarexporter) legacyLoad(tmpDir string, outStream io.Writer, progressOut
 	return nil
 }
 
-func (l *tarexporter) legacyLoadImage(oldID, sourceDir string, loadedMap map[string]image.ID, progressOutput progress.Output) error {
-	if _, loaded := loadedMap[oldID]; loaded {
-		return nil
-	}
-	configPath, err := safePath(sourceDir, filepath.Join(oldID, legacyConfigFileName))
-	if err != nil {
-		return err
-	}
-	imageJSON, err := os.ReadFile(configPath)
-	if err != nil {
-		log.G(context.TODO()).Debugf("Error reading json: %v", err)
-		return err
-	}
+// legacyLoadState synchronizes concurrent legacyLoadImage calls that race
+// to load the same parent image, so each oldID's image is only ever
+// built once.
+type legacyLoadState struct {
+	mu     sync.Mutex
+	once   map[string]*sync.Once
+	loaded map[string]image.ID
+	err    map[string]error
+}
 
-	var img struct {
-		OS     string
-		Parent string
-	}
-	if err := json.Unmarshal(imageJSON, &img); err != nil {
-		return err
+func newLegacyLoadState() *legacyLoadState {
+	return &legacyLoadState{
+		once:   make(map[string]*sync.Once),
+		loaded: make(map[string]image.ID),
+		err:    make(map[string]error),
 	}
+}
 
-	if img.OS == "" {
-		img.OS = runtime.GOOS
-	}
-	if err := image.CheckOS(img.OS); err != nil {
-		return fmt.Errorf("cannot load %s image on %s", img.OS, runtime.GOOS)
-	}
+func (s *legacyLoadState) get(oldID string) (image.ID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.loaded[oldID]
+	return id, ok
+}
 
-	var parentID image.ID
-	if img.Parent != "" {
-		for {
-			var loaded bool
-			if parentID, loaded = loadedMap[img.Parent]; !loaded {
-				if err := l.legacyLoadImage(img.Parent, sourceDir, loadedMap, progressOutput); err != nil {
-					return err
-				}
-			} else {
-				break
-			}
+func (s *legacyLoadState) do(oldID string, load func() (image.ID, error)) (image.ID, error) {
+	s.mu.Lock()
+	once, ok := s.once[oldID]
+	if !ok {
+		once = &sync.Once{}
+		s.once[oldID] = once
+	}
+	s.mu.Unlock()
+
+	once.Do(func() {
+		imgID, err := load()
+		s.mu.Lock()
+		s.loaded[oldID], s.err[oldID] = imgID, err
+		s.mu.Unlock()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loaded[oldID], s.err[oldID]
+}
+
+func (l *tarexporter) legacyLoadImage(ctx context.Context, pool *loaderPool, oldID, sourceDir string, state *legacyLoadState, progressOutput progress.Output) (image.ID, error) {
+	return state.do(oldID, func() (image.ID, error) {
+		configPath, err := safePath(sourceDir, filepath.Join(oldID, legacyConfigFileName))
+		if err != nil {
+			return "", err
+		}
+		imageJSON, err := os.ReadFile(configPath)
+		if err != nil {
+			log.G(context.TODO()).Debugf("Error reading json: %v", err)
+			return "", err
 		}
-	}
 
-	// todo: try to connect with migrate code
-	rootFS := image.NewRootFS()
-	var history []image.History
+		var img struct {
+			OS     string
+			Parent string
+		}
+		if err := json.Unmarshal(imageJSON, &img); err != nil {
+			return "", err
+		}
 
-	if parentID != "" {
-		parentImg, err := l.is.Get(parentID)
-		if err != nil {
-			return err
+		if img.OS == "" {
+			img.OS = runtime.GOOS
+		}
+		if err := image.CheckOS(img.OS); err != nil {
+			return "", fmt.Errorf("cannot load %s image on %s", img.OS, runtime.GOOS)
 		}
 
-		rootFS = parentImg.RootFS
-		history = parentImg.History
-	}
+		var parentID image.ID
+		if img.Parent != "" {
+			parentID, err = l.legacyLoadImage(ctx, pool, img.Parent, sourceDir, state, progressOutput)
+			if err != nil {
+				return "", err
+			}
+		}
 
-	layerPath, err := safePath(sourceDir, filepath.Join(oldID, legacyLayerFileName))
-	if err != nil {
-		return err
-	}
-	newLayer, err := l.loadLayer(context.TODO(), layerPath, *rootFS, oldID, distribution.Descriptor{}, progressOutput)
-	if err != nil {
-		return err
-	}
-	rootFS.Append(newLayer.DiffID())
+		// todo: try to connect with migrate code
+		rootFS := image.NewRootFS()
+		var history []image.History
 
-	h, err := v1.HistoryFromConfig(imageJSON, false)
-	if err != nil {
-		return err
-	}
-	history = append(history, h)
+		if parentID != "" {
+			parentImg, err := l.is.Get(parentID)
+			if err != nil {
+				return "", err
+			}
 
-	config, err := v1.MakeConfigFromV1Config(imageJSON, rootFS, history)
-	if err != nil {
-		return err
-	}
-	imgID, err := l.is.Create(config)
-	if err != nil {
-		return err
-	}
+			rootFS = parentImg.RootFS
+			history = parentImg.History
+		}
 
-	metadata, err := l.lss.Release(newLayer)
-	layer.LogReleaseMetadata(metadata)
-	if err != nil {
-		return err
-	}
+		layerPath, err := safePath(sourceDir, filepath.Join(oldID, legacyLayerFileName))
+		if err != nil {
+			return "", err
+		}
+		// The legacy (pre-1.10) format predates DiffIDs: unlike loadLayers,
+		// there is no expected chain to look up ahead of time, so this
+		// layer is always decompressed (or cache-hit) and registered
+		// directly rather than going through the pool for prefetching.
+		prepared, err := l.prepareLayer(ctx, layerPath, progressOutput, oldID)
+		if err != nil {
+			return "", err
+		}
+		newLayer, err := l.registerPreparedLayer(prepared, *rootFS, distribution.Descriptor{})
+		if prepared.spillPath != "" {
+			os.Remove(prepared.spillPath)
+		}
+		if err != nil {
+			return "", err
+		}
+		rootFS.Append(newLayer.DiffID())
 
-	if parentID != "" {
-		if err := l.is.SetParent(imgID, parentID); err != nil {
-			return err
+		h, err := v1.HistoryFromConfig(imageJSON, false)
+		if err != nil {
+			return "", err
 		}
-	}
+		history = append(history, h)
 
-	loadedMap[oldID] = imgID
-	return nil
+		config, err := v1.MakeConfigFromV1Config(imageJSON, rootFS, history)
+		if err != nil {
+			return "", err
+		}
+		imgID, err := l.is.Create(config)
+		if err != nil {
+			return "", err
+		}
+
+		metadata, err := l.lss.Release(newLayer)
+		layer.LogReleaseMetadata(metadata)
+		if err != nil {
+			return "", err
+		}
+
+		if parentID != "" {
+			if err := l.is.SetParent(imgID, parentID); err != nil {
+				return "", err
+			}
+		}
+
+		return imgID, nil
+	})
 }
 
 func safePath(base, path string) (string, error) {
@@ -0,0 +1,362 @@
+package tarexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/docker/distribution"
+)
+
+// ociLayoutFileName is the marker file that identifies an untarred
+// directory as an OCI image layout, as defined by the image-spec.
+const ociLayoutFileName = "oci-layout"
+
+// isOCILayout reports whether tmpDir looks like an OCI image layout, which
+// is a directory holding an "oci-layout" marker file next to "index.json"
+// and a "blobs/" directory of content-addressable files. Only the marker
+// file is checked.
+func isOCILayout(tmpDir string) bool {
+	_, err := os.Stat(filepath.Join(tmpDir, ociLayoutFileName))
+	return err == nil
+}
+
+// ociBlobPath resolves the content-addressable path of desc within an OCI
+// image layout rooted at tmpDir, following the "blobs/<algorithm>/<encoded>"
+// layout mandated by the image-spec.
+func ociBlobPath(tmpDir string, desc ocispec.Descriptor) (string, error) {
+	return safePath(tmpDir, filepath.Join("blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded()))
+}
+
+// ociLoad loads an OCI image layout rooted at tmpDir, as detected by
+// isOCILayout. It walks the top-level index.json and, for every manifest
+// or index entry it contains, reuses loadLayers to register layers and
+// l.is.Create to create images, exactly as the Docker manifest.json format
+// does.
+//
+// pool bounds concurrent top-level entries; layerPool separately bounds
+// concurrent layer decompression reached through them (see Load for why
+// these must stay distinct pools).
+func (l *tarexporter) ociLoad(ctx context.Context, pool, layerPool *loaderPool, tmpDir string, outStream io.Writer, progressOutput progress.Output) error {
+	indexPath, err := safePath(tmpDir, ocispec.ImageIndexFile)
+	if err != nil {
+		return err
+	}
+	indexFile, err := os.Open(indexPath)
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	var idx ocispec.Index
+	if err := json.NewDecoder(indexFile).Decode(&idx); err != nil {
+		return err
+	}
+
+	// Each top-level entry is independent of the others, so resolve them
+	// through the shared pool and only serialize the tagging/printing
+	// step, to keep output order stable regardless of completion order.
+	type ociLoadResult struct {
+		imgIDs     []image.ID
+		skipReason string
+		// referrer is true for an entry that is itself a signature,
+		// attestation, or other OCI 1.1 referrer of another manifest in
+		// idx (identified by its "subject" field) rather than a loadable
+		// image; it is silently excluded from the image walk below.
+		referrer bool
+	}
+	results := make([]ociLoadResult, len(idx.Manifests))
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for i, desc := range idx.Manifests {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		i, desc := i, desc
+		wg.Add(1)
+		if err := pool.Go(ctx, func() {
+			defer wg.Done()
+
+			isReferrer, err := isOCIReferrerManifest(tmpDir, desc)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			if isReferrer {
+				results[i] = ociLoadResult{referrer: true}
+				return
+			}
+
+			if err := l.verifyOCISignatures(tmpDir, idx, desc); err != nil {
+				if currentLoadPolicy().StrictPolicy {
+					errOnce.Do(func() { firstErr = err })
+					return
+				}
+				results[i] = ociLoadResult{skipReason: err.Error()}
+				return
+			}
+
+			imgIDs, err := l.ociLoadDescriptor(ctx, layerPool, tmpDir, desc, progressOutput)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			results[i] = ociLoadResult{imgIDs: imgIDs}
+		}); err != nil {
+			wg.Done()
+			wg.Wait()
+			return err
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	var imageIDsStr string
+	var imageRefCount int
+
+	for i, res := range results {
+		if res.referrer {
+			continue
+		}
+		if res.skipReason != "" {
+			fmt.Fprintf(outStream, "Skipping image: signature policy check failed: %s\n", res.skipReason)
+			continue
+		}
+		repoTag := idx.Manifests[i].Annotations[ocispec.AnnotationRefName]
+		tagged := false
+		for _, imgID := range res.imgIDs {
+			imageIDsStr += fmt.Sprintf("Loaded image ID: %s\n", imgID)
+
+			if repoTag == "" {
+				continue
+			}
+			if tagged {
+				// res.imgIDs holds every platform-specific image produced by
+				// a multi-platform index entry loaded without a
+				// l.platformMatcher (the Swarm case); AddTag can only ever
+				// point repoTag at one of them, so only the first is tagged
+				// and the rest stay reachable by ID alone, matching what's
+				// actually left in the repository store.
+				continue
+			}
+			named, err := reference.ParseNormalizedNamed(repoTag)
+			if err != nil {
+				return err
+			}
+			ref, ok := named.(reference.NamedTagged)
+			if !ok {
+				return fmt.Errorf("invalid tag %q", repoTag)
+			}
+			l.setLoadedTag(ref, imgID.Digest(), outStream)
+			fmt.Fprintf(outStream, "Loaded image: %s\n", reference.FamiliarString(ref))
+			imageRefCount++
+			tagged = true
+		}
+	}
+
+	if imageRefCount == 0 {
+		outStream.Write([]byte(imageIDsStr))
+	}
+
+	return nil
+}
+
+// isOCIReferrerManifest reports whether the image manifest at desc points
+// at another manifest via the OCI 1.1 "subject" field, marking it as a
+// signature, attestation, or other referrer rather than a loadable image
+// in its own right. Only ocispec.MediaTypeImageManifest entries can carry
+// a subject, so anything else (in particular an image index) is never a
+// referrer.
+func isOCIReferrerManifest(tmpDir string, desc ocispec.Descriptor) (bool, error) {
+	if desc.MediaType != ocispec.MediaTypeImageManifest {
+		return false, nil
+	}
+	manifestPath, err := ociBlobPath(tmpDir, desc)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var m ocispec.Manifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return false, err
+	}
+	return m.Subject != nil, nil
+}
+
+// ociLoadDescriptor loads the image or images described by desc and returns
+// the image.ID of every image.Store entry it created. desc may describe
+// either a single image manifest or an image index nesting further
+// manifests (for example a multi-platform index).
+func (l *tarexporter) ociLoadDescriptor(ctx context.Context, layerPool *loaderPool, tmpDir string, desc ocispec.Descriptor, progressOutput progress.Output) ([]image.ID, error) {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex:
+		return l.ociLoadIndex(ctx, layerPool, tmpDir, desc, progressOutput)
+	case ocispec.MediaTypeImageManifest:
+		imgID, err := l.ociLoadManifest(ctx, layerPool, tmpDir, desc, progressOutput)
+		if err != nil {
+			return nil, err
+		}
+		return []image.ID{imgID}, nil
+	default:
+		return nil, fmt.Errorf("unsupported descriptor media type: %s", desc.MediaType)
+	}
+}
+
+// ociLoadIndex loads the first manifest in the image index described by
+// desc that matches l.platformMatcher; later matching entries are not
+// loaded. When no matcher is configured (the Swarm case), every platform
+// entry is loaded; the caller tags only the first resulting image under the
+// entry's reference and leaves the others reachable by ID alone.
+func (l *tarexporter) ociLoadIndex(ctx context.Context, layerPool *loaderPool, tmpDir string, desc ocispec.Descriptor, progressOutput progress.Output) ([]image.ID, error) {
+	indexPath, err := ociBlobPath(tmpDir, desc)
+	if err != nil {
+		return nil, err
+	}
+	indexFile, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer indexFile.Close()
+
+	var idx ocispec.Index
+	if err := json.NewDecoder(indexFile).Decode(&idx); err != nil {
+		return nil, err
+	}
+
+	var imgIDs []image.ID
+	for _, m := range idx.Manifests {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if isReferrer, err := isOCIReferrerManifest(tmpDir, m); err != nil {
+			return nil, err
+		} else if isReferrer {
+			continue
+		}
+
+		if l.platformMatcher != nil {
+			if m.Platform == nil || !l.platformMatcher.Match(platforms.Normalize(*m.Platform)) {
+				continue
+			}
+			ids, err := l.ociLoadDescriptor(ctx, layerPool, tmpDir, m, progressOutput)
+			if err != nil {
+				return nil, err
+			}
+			return ids, nil
+		}
+
+		ids, err := l.ociLoadDescriptor(ctx, layerPool, tmpDir, m, progressOutput)
+		if err != nil {
+			return nil, err
+		}
+		imgIDs = append(imgIDs, ids...)
+	}
+
+	return imgIDs, nil
+}
+
+// ociLoadManifest loads the single OCI image manifest described by desc:
+// its config and layer blobs are resolved through the image layout's
+// blobs/ directory and handed to the same image.Create / loadLayers path
+// used by the Docker manifest.json format.
+func (l *tarexporter) ociLoadManifest(ctx context.Context, layerPool *loaderPool, tmpDir string, desc ocispec.Descriptor, progressOutput progress.Output) (image.ID, error) {
+	manifestPath, err := ociBlobPath(tmpDir, desc)
+	if err != nil {
+		return "", err
+	}
+	manifestFile, err := os.Open(manifestPath)
+	if err != nil {
+		return "", err
+	}
+	defer manifestFile.Close()
+
+	var manifest ocispec.Manifest
+	if err := json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		return "", err
+	}
+
+	configPath, err := ociBlobPath(tmpDir, manifest.Config)
+	if err != nil {
+		return "", err
+	}
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	img, err := image.NewFromJSON(config)
+	if err != nil {
+		return "", err
+	}
+	if err := image.CheckOS(img.OperatingSystem()); err != nil {
+		return "", fmt.Errorf("cannot load %s image on %s", img.OperatingSystem(), runtime.GOOS)
+	}
+
+	if expected, actual := len(manifest.Layers), len(img.RootFS.DiffIDs); expected != actual {
+		return "", fmt.Errorf("invalid manifest, layers length mismatch: expected %d, got %d", expected, actual)
+	}
+
+	rootFS := *img.RootFS
+	rootFS.DiffIDs = nil
+
+	jobs := make([]layerJob, len(manifest.Layers))
+	for i, layerDesc := range manifest.Layers {
+		switch layerDesc.MediaType {
+		case ocispec.MediaTypeImageLayer, ocispec.MediaTypeImageLayerGzip, ocispec.MediaTypeImageLayerZstd,
+			ocispec.MediaTypeImageLayerNonDistributable, ocispec.MediaTypeImageLayerNonDistributableGzip, ocispec.MediaTypeImageLayerNonDistributableZstd: //nolint:staticcheck // non-distributable media types are deprecated but still produced by some tools.
+		default:
+			return "", fmt.Errorf("unsupported layer media type: %s", layerDesc.MediaType)
+		}
+
+		layerPath, err := ociBlobPath(tmpDir, layerDesc)
+		if err != nil {
+			return "", err
+		}
+		jobs[i] = layerJob{
+			diffID: img.RootFS.DiffIDs[i],
+			path:   layerPath,
+			foreignSrc: distribution.Descriptor{
+				MediaType: layerDesc.MediaType,
+				Digest:    layerDesc.Digest,
+				Size:      layerDesc.Size,
+				URLs:      layerDesc.URLs,
+			},
+		}
+	}
+
+	newLayers, err := l.loadLayers(ctx, layerPool, rootFS, jobs, progressOutput)
+	if err != nil {
+		return "", err
+	}
+	for _, newLayer := range newLayers {
+		defer layer.ReleaseAndLog(l.lss, newLayer)
+	}
+
+	return l.is.Create(config)
+}
@@ -0,0 +1,108 @@
+package tarexport
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/docker/docker/pkg/progress"
+)
+
+// loaderPool bounds the number of layers being decompressed and registered
+// concurrently during a single Load call. It is shared by the Docker
+// manifest.json loader and the OCI image layout loader so that loading a
+// multi-platform tar never spins up more concurrent decompressors than the
+// pool allows, regardless of which format produced the work.
+type loaderPool struct {
+	sem chan struct{}
+}
+
+// defaultLoadConcurrency returns the pool width used when Load is not given
+// an explicit concurrency: one worker per available CPU.
+func defaultLoadConcurrency() int {
+	if n := runtime.GOMAXPROCS(0); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// loadConcurrencyMu guards loadConcurrency the same way loadPolicyMu guards
+// globalLoadPolicy: SetLoadConcurrency can race with a concurrent Load
+// reading it to size its pools.
+var loadConcurrencyMu sync.RWMutex
+
+// loadConcurrency is the pool width installed by SetLoadConcurrency. Zero
+// (the default) means "use defaultLoadConcurrency". Access it only through
+// currentLoadConcurrency.
+var loadConcurrency int
+
+// SetLoadConcurrency overrides the width of the worker pools Load and
+// ociLoad use to bound concurrent layer decompression, in place of one
+// worker per CPU. A non-positive n reverts to that default. It is normally
+// called once during daemon startup from a --load-concurrency style
+// setting.
+func SetLoadConcurrency(n int) {
+	loadConcurrencyMu.Lock()
+	defer loadConcurrencyMu.Unlock()
+	loadConcurrency = n
+}
+
+// currentLoadConcurrency returns the pool width installed by the most
+// recent SetLoadConcurrency call, or defaultLoadConcurrency if none was
+// installed (or it was reset to a non-positive value).
+func currentLoadConcurrency() int {
+	loadConcurrencyMu.RLock()
+	defer loadConcurrencyMu.RUnlock()
+	if loadConcurrency > 0 {
+		return loadConcurrency
+	}
+	return defaultLoadConcurrency()
+}
+
+// newLoaderPool returns a pool that allows at most n concurrent workers. A
+// non-positive n falls back to currentLoadConcurrency.
+func newLoaderPool(n int) *loaderPool {
+	if n <= 0 {
+		n = currentLoadConcurrency()
+	}
+	return &loaderPool{sem: make(chan struct{}, n)}
+}
+
+// Go blocks until a pool slot is available or ctx is done, then runs fn in
+// a new goroutine and releases the slot once fn returns. Callers are
+// responsible for their own completion signalling (e.g. a sync.WaitGroup)
+// and for propagating any error fn produces.
+func (p *loaderPool) Go(ctx context.Context, fn func()) error {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	go func() {
+		defer func() { <-p.sem }()
+		fn()
+	}()
+	return nil
+}
+
+// syncProgress wraps out so it is safe to call from the multiple
+// goroutines the pool runs concurrently; a plain progress.Output isn't
+// guaranteed to be. This mirrors how distribution/xfer serializes
+// progress updates from its own concurrent layer downloads.
+func syncProgress(out progress.Output) progress.Output {
+	if out == nil {
+		return nil
+	}
+	return &synchronizedProgress{out: out}
+}
+
+type synchronizedProgress struct {
+	mu  sync.Mutex
+	out progress.Output
+}
+
+func (s *synchronizedProgress) WriteProgress(p progress.Progress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.WriteProgress(p)
+}
@@ -0,0 +1,61 @@
+package sysinfo
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/containerd/log"
+)
+
+// criuRequiredFeatures are the `criu check --feature` flags docker's
+// checkpoint/restore support relies on. mnt_id is needed to restore bind
+// mounts by external mount ID, and compat_cr is needed for CRIU's
+// cgroup-compat mode when the host only has one cgroup hierarchy mounted.
+var criuRequiredFeatures = []string{"mnt_id", "compat_cr"}
+
+// WithCRIU probes for a working `criu` binary and records whether it
+// supports the features docker's checkpoint/restore support requires.
+func WithCRIU() Opt {
+	return func(info *SysInfo) {
+		version, err := criuVersion()
+		if err != nil {
+			log.G(context.TODO()).Debugf("criu not available: %v", err)
+			return
+		}
+		info.CRIUVersion = version
+
+		var missing []string
+		for _, feature := range criuRequiredFeatures {
+			if !criuHasFeature(feature) {
+				missing = append(missing, feature)
+			}
+		}
+		if len(missing) > 0 {
+			info.Warnings = append(info.Warnings, "criu is missing required feature(s): "+strings.Join(missing, ", "))
+			return
+		}
+		info.CRIU = true
+	}
+}
+
+func criuVersion() (string, error) {
+	out, err := exec.Command("criu", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// criuHasFeature shells out to `criu check --feature <name>`, which prints
+// "Looking good." and exits 0 when the feature is supported.
+func criuHasFeature(feature string) bool {
+	var stdout bytes.Buffer
+	cmd := exec.Command("criu", "check", "--feature", feature)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	return strings.Contains(stdout.String(), "Looking good")
+}
@@ -30,6 +30,12 @@ type SysInfo struct {
 	// Whether the cgroup is in unified mode (v2).
 	CgroupUnified bool
 
+	// Whether CRIU is available for checkpoint/restore, and if so, which
+	// version was detected. CRIUVersion is the empty string when CRIU is
+	// false.
+	CRIU        bool
+	CRIUVersion string
+
 	// Warnings contains a slice of warnings that occurred  while collecting
 	// system information. These warnings are intended to be informational
 	// messages for the user, and can either be logged or returned to the